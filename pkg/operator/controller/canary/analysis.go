@@ -0,0 +1,298 @@
+package canary
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	operatorv1 "github.com/openshift/api/operator/v1"
+	routev1 "github.com/openshift/api/route/v1"
+
+	"github.com/openshift/cluster-ingress-operator/pkg/operator/controller"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	logf "sigs.k8s.io/controller-runtime/pkg/log"
+)
+
+var log = logf.Log.WithName("canary_analysis_controller")
+
+// analysisState tracks the in-progress weighted rollout for a single
+// IngressController between reconciles. It is kept in memory (rather than
+// persisted) because it can always be rebuilt from the current and previous
+// router deployment generations, and losing it on operator restart simply
+// means the rollout restarts its analysis window from zero.
+type analysisState struct {
+	weight              int32
+	consecutiveFailures int32
+}
+
+// AnalysisController drives a Flagger-style weighted canary analysis for an
+// IngressController's router rollout. It is invoked by the canary
+// controller's reconcile loop on every reconcile, and only acts while a new
+// router deployment revision is in progress and the IngressController has
+// CanaryAnalysis configured; when CanaryAnalysis is unset the router
+// deployment's native rolling update strategy is left to run unmodified.
+type AnalysisController struct {
+	client client.Client
+
+	// probe is used to evaluate whether the current canary weight is
+	// meeting the configured SLO. It defaults to a Prometheus-backed
+	// prober and falls back to synthetic curl probes when the in-cluster
+	// monitoring stack is unreachable.
+	probe canaryProber
+
+	state map[types.NamespacedName]*analysisState
+
+	// stableTemplates caches the most recently observed router deployment
+	// pod template while no rollout was in progress for that
+	// IngressController, so a halted analysis can revert Spec.Template to
+	// the last known-good revision instead of leaving the deployment's own
+	// rolling update to keep progressing toward the bad spec.
+	stableTemplates map[types.NamespacedName]corev1.PodTemplateSpec
+}
+
+// NewAnalysisController returns an AnalysisController that uses cl to read
+// and update IngressControllers and their router deployments, and kubeClient
+// to run the synthetic curl probes the fallback prober uses when Prometheus
+// can't be reached. promURL is the address of the in-cluster Thanos/
+// Prometheus query endpoint used to probe canary metrics; it may be empty,
+// in which case only synthetic curl probes are used.
+func NewAnalysisController(cl client.Client, kubeClient kubernetes.Interface, promURL string) *AnalysisController {
+	return &AnalysisController{
+		client:          cl,
+		probe:           newFallbackProber(cl, kubeClient, promURL),
+		state:           map[types.NamespacedName]*analysisState{},
+		stableTemplates: map[types.NamespacedName]corev1.PodTemplateSpec{},
+	}
+}
+
+// Reconcile advances the canary analysis for ic by at most one step. It
+// returns the duration the caller should wait before calling Reconcile
+// again: the configured analysis interval (30s if unset) while a rollout is
+// being analysed, and 0 when CanaryAnalysis is unset or no rollout is in
+// progress.
+func (c *AnalysisController) Reconcile(ctx context.Context, ic *operatorv1.IngressController, rolloutInProgress bool) (time.Duration, error) {
+	analysis := ic.Spec.CanaryAnalysis
+	if analysis == nil || !rolloutInProgress {
+		c.reset(ic)
+		if err := c.captureStableTemplate(ctx, ic); err != nil {
+			return 0, fmt.Errorf("failed to capture known-good router deployment revision for ingresscontroller %s: %w", ic.Name, err)
+		}
+		return 0, nil
+	}
+
+	interval := analysis.Interval.Duration
+	if interval <= 0 {
+		interval = 30 * time.Second
+	}
+
+	key := types.NamespacedName{Namespace: ic.Namespace, Name: ic.Name}
+	st, ok := c.state[key]
+	if !ok {
+		st = &analysisState{weight: analysis.StepWeight}
+		c.state[key] = st
+	}
+
+	passed, err := c.probe.Check(ctx, ic, analysis.Metrics)
+	if err != nil {
+		return interval, fmt.Errorf("failed to evaluate canary metrics for ingresscontroller %s: %w", key, err)
+	}
+
+	st.weight, st.consecutiveFailures = nextAnalysisStep(st.weight, st.consecutiveFailures, passed, analysis)
+	halted := st.consecutiveFailures >= analysis.Threshold
+	promoted := !halted && st.weight >= analysis.MaxWeight
+
+	// Promotion hands all traffic to the new router pods; a halt drives the
+	// canary weight back to zero via rollback below.
+	weight := st.weight
+	if promoted {
+		weight = 100
+	}
+	if halted {
+		weight = 0
+	}
+
+	if !halted {
+		if err := c.setWeightValue(ctx, ic, weight); err != nil {
+			return interval, fmt.Errorf("failed to update canary weight for ingresscontroller %s: %w", key, err)
+		}
+	}
+
+	if err := c.updateStatus(ctx, ic, weight, buildAnalysisConditions(halted, promoted)); err != nil {
+		return interval, fmt.Errorf("failed to update canary analysis status for ingresscontroller %s: %w", key, err)
+	}
+
+	if halted {
+		if err := c.rollback(ctx, ic); err != nil {
+			return interval, fmt.Errorf("failed to roll back ingresscontroller %s after halted canary analysis: %w", key, err)
+		}
+		delete(c.state, key)
+	}
+	if promoted {
+		delete(c.state, key)
+	}
+
+	return interval, nil
+}
+
+// nextAnalysisStep computes the next canary weight and consecutive failure
+// count given the previous step's result. It is a pure function so the
+// step/threshold/maxWeight arithmetic can be unit tested without a fake
+// client or prober.
+func nextAnalysisStep(weight, consecutiveFailures int32, passed bool, analysis *operatorv1.CanaryAnalysis) (int32, int32) {
+	if !passed {
+		return weight, consecutiveFailures + 1
+	}
+	weight += analysis.StepWeight
+	if weight > analysis.MaxWeight {
+		weight = analysis.MaxWeight
+	}
+	return weight, 0
+}
+
+func (c *AnalysisController) reset(ic *operatorv1.IngressController) {
+	delete(c.state, types.NamespacedName{Namespace: ic.Namespace, Name: ic.Name})
+}
+
+// captureStableTemplate records ic's router deployment's current pod
+// template as the last known-good revision, so that a subsequent rollback
+// has something to revert to. It is called only while no rollout is in
+// progress, i.e. whenever the deployment's template reflects a revision that
+// has already been running successfully.
+func (c *AnalysisController) captureStableTemplate(ctx context.Context, ic *operatorv1.IngressController) error {
+	deployment := &appsv1.Deployment{}
+	if err := c.client.Get(ctx, controller.RouterDeploymentName(ic), deployment); err != nil {
+		return err
+	}
+	key := types.NamespacedName{Namespace: ic.Namespace, Name: ic.Name}
+	c.stableTemplates[key] = deployment.Spec.Template
+	return nil
+}
+
+// canaryServiceName returns the name of the Service that fronts only the
+// new (canary) router pods for ic's rollout, as distinct from the stable
+// Service that fronts the router deployment as a whole. A Route only splits
+// traffic proportionally across two or more weighted backends, so
+// progressively shifting traffic to the canary requires both Services to be
+// present as backends on the canary route, not just a weight on the sole
+// existing one.
+func canaryServiceName(ic *operatorv1.IngressController) string {
+	return controller.RouterDeploymentName(ic).Name + "-canary"
+}
+
+// setWeightValue adjusts the proportion of traffic routed to the canary
+// (new) router pods versus the stable (current) router pods by reweighting
+// the canary route's two backends: Spec.To, which continues to point at the
+// stable router Service, and a Spec.AlternateBackends entry pointing at the
+// canary Service, which only selects the new router pods. weight is the
+// percentage, 0-100, of traffic that should go to the canary backend.
+func (c *AnalysisController) setWeightValue(ctx context.Context, ic *operatorv1.IngressController, weight int32) error {
+	route := &routev1.Route{}
+	name := controller.CanaryRouteName()
+	if err := c.client.Get(ctx, name, route); err != nil {
+		return err
+	}
+
+	stableWeight := int32(100) - weight
+	canaryWeight := weight
+	canaryBackend := canaryServiceName(ic)
+
+	changed := false
+	if route.Spec.To.Weight == nil || *route.Spec.To.Weight != stableWeight {
+		route.Spec.To.Weight = &stableWeight
+		changed = true
+	}
+
+	found := false
+	for i := range route.Spec.AlternateBackends {
+		if route.Spec.AlternateBackends[i].Name != canaryBackend {
+			continue
+		}
+		found = true
+		if route.Spec.AlternateBackends[i].Weight == nil || *route.Spec.AlternateBackends[i].Weight != canaryWeight {
+			route.Spec.AlternateBackends[i].Weight = &canaryWeight
+			changed = true
+		}
+	}
+	if !found {
+		route.Spec.AlternateBackends = append(route.Spec.AlternateBackends, routev1.RouteTargetReference{
+			Kind:   "Service",
+			Name:   canaryBackend,
+			Weight: &canaryWeight,
+		})
+		changed = true
+	}
+
+	if !changed {
+		return nil
+	}
+	return c.client.Update(ctx, route)
+}
+
+// rollback drives the canary weight back to zero and reverts the router
+// deployment's pod template to the last known-good revision captured by
+// captureStableTemplate. A Deployment's own rolling update strategy never
+// reverts itself: left alone it keeps progressing toward whatever
+// Spec.Template it was last given, so halting analysis has to actively
+// restore the previous template rather than merely stop shifting traffic.
+func (c *AnalysisController) rollback(ctx context.Context, ic *operatorv1.IngressController) error {
+	log.Info("halting canary analysis and rolling back router deployment", "ingresscontroller", ic.Name)
+
+	key := types.NamespacedName{Namespace: ic.Namespace, Name: ic.Name}
+	stableTemplate, ok := c.stableTemplates[key]
+	if !ok {
+		return fmt.Errorf("no known-good router deployment revision recorded for ingresscontroller %s; cannot roll back", ic.Name)
+	}
+
+	deployment := &appsv1.Deployment{}
+	if err := c.client.Get(ctx, controller.RouterDeploymentName(ic), deployment); err != nil {
+		return err
+	}
+	deployment.Spec.Template = stableTemplate
+	if err := c.client.Update(ctx, deployment); err != nil {
+		return fmt.Errorf("failed to revert router deployment %s to last known-good revision: %w", deployment.Name, err)
+	}
+
+	return c.setWeightValue(ctx, ic, 0)
+}
+
+func (c *AnalysisController) updateStatus(ctx context.Context, ic *operatorv1.IngressController, weight int32, conditions []operatorv1.OperatorCondition) error {
+	updated := ic.DeepCopy()
+	updated.Status.CanaryWeight = weight
+	for _, cond := range conditions {
+		setOperatorCondition(&updated.Status.Conditions, cond)
+	}
+	return c.client.Status().Update(ctx, updated)
+}
+
+func buildAnalysisConditions(halted, promoted bool) []operatorv1.OperatorCondition {
+	progressing := operatorv1.ConditionTrue
+	if halted || promoted {
+		progressing = operatorv1.ConditionFalse
+	}
+	return []operatorv1.OperatorCondition{
+		{
+			Type:   CanaryAnalysisProgressingConditionType,
+			Status: progressing,
+		},
+		{
+			Type:   CanaryAnalysisPromotedConditionType,
+			Status: boolToConditionStatus(promoted),
+		},
+		{
+			Type:   CanaryAnalysisHaltedConditionType,
+			Status: boolToConditionStatus(halted),
+		},
+	}
+}
+
+func boolToConditionStatus(b bool) operatorv1.ConditionStatus {
+	if b {
+		return operatorv1.ConditionTrue
+	}
+	return operatorv1.ConditionFalse
+}
@@ -0,0 +1,239 @@
+package canary
+
+import (
+	"context"
+	"testing"
+
+	operatorv1 "github.com/openshift/api/operator/v1"
+	routev1 "github.com/openshift/api/route/v1"
+
+	"github.com/openshift/cluster-ingress-operator/pkg/operator/controller"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	fakeclient "sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func TestNextAnalysisStep(t *testing.T) {
+	analysis := &operatorv1.CanaryAnalysis{
+		StepWeight: 10,
+		MaxWeight:  50,
+		Threshold:  3,
+	}
+
+	testCases := []struct {
+		name                string
+		weight              int32
+		consecutiveFailures int32
+		passed              bool
+		expectWeight        int32
+		expectFailures      int32
+	}{
+		{
+			name:           "successful sample advances weight by stepWeight",
+			weight:         10,
+			passed:         true,
+			expectWeight:   20,
+			expectFailures: 0,
+		},
+		{
+			name:           "weight never exceeds maxWeight",
+			weight:         45,
+			passed:         true,
+			expectWeight:   50,
+			expectFailures: 0,
+		},
+		{
+			name:                "failed sample leaves weight unchanged and increments failures",
+			weight:              20,
+			consecutiveFailures: 1,
+			passed:              false,
+			expectWeight:        20,
+			expectFailures:      2,
+		},
+		{
+			name:                "successful sample resets the failure counter",
+			weight:              20,
+			consecutiveFailures: 2,
+			passed:              true,
+			expectWeight:        30,
+			expectFailures:      0,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			weight, failures := nextAnalysisStep(tc.weight, tc.consecutiveFailures, tc.passed, analysis)
+			if weight != tc.expectWeight {
+				t.Errorf("expected weight %d, got %d", tc.expectWeight, weight)
+			}
+			if failures != tc.expectFailures {
+				t.Errorf("expected %d consecutive failures, got %d", tc.expectFailures, failures)
+			}
+		})
+	}
+}
+
+// TestSetWeightValueSplitsTrafficAcrossTwoBackends verifies that
+// setWeightValue splits traffic between the stable backend (Spec.To) and
+// the canary backend (Spec.AlternateBackends), since a Route only
+// proportionally splits traffic across two or more weighted backends; a
+// weight on a single backend has no effect on actual traffic.
+func TestSetWeightValueSplitsTrafficAcrossTwoBackends(t *testing.T) {
+	scheme := runtime.NewScheme()
+	if err := routev1.Install(scheme); err != nil {
+		t.Fatalf("failed to install route/v1 scheme: %v", err)
+	}
+	if err := operatorv1.Install(scheme); err != nil {
+		t.Fatalf("failed to install operator/v1 scheme: %v", err)
+	}
+
+	ic := &operatorv1.IngressController{
+		ObjectMeta: metav1.ObjectMeta{Name: "default", Namespace: "openshift-ingress-operator"},
+	}
+
+	name := controller.CanaryRouteName()
+	stableWeight := int32(100)
+	route := &routev1.Route{
+		ObjectMeta: metav1.ObjectMeta{Name: name.Name, Namespace: name.Namespace},
+		Spec: routev1.RouteSpec{
+			To: routev1.RouteTargetReference{Kind: "Service", Name: "router-canary-stable", Weight: &stableWeight},
+		},
+	}
+
+	cl := fakeclient.NewClientBuilder().WithScheme(scheme).WithObjects(route).Build()
+	c := &AnalysisController{client: cl}
+
+	if err := c.setWeightValue(context.Background(), ic, 30); err != nil {
+		t.Fatalf("setWeightValue returned an error: %v", err)
+	}
+
+	updated := &routev1.Route{}
+	if err := cl.Get(context.Background(), types.NamespacedName{Namespace: route.Namespace, Name: route.Name}, updated); err != nil {
+		t.Fatalf("failed to get updated route: %v", err)
+	}
+
+	if got, want := *updated.Spec.To.Weight, int32(70); got != want {
+		t.Errorf("expected stable backend weight %d, got %d", want, got)
+	}
+	if len(updated.Spec.AlternateBackends) != 1 {
+		t.Fatalf("expected exactly one alternate backend, got %d", len(updated.Spec.AlternateBackends))
+	}
+	canary := updated.Spec.AlternateBackends[0]
+	if canary.Name != canaryServiceName(ic) {
+		t.Errorf("expected alternate backend %q, got %q", canaryServiceName(ic), canary.Name)
+	}
+	if got, want := *canary.Weight, int32(30); got != want {
+		t.Errorf("expected canary backend weight %d, got %d", want, got)
+	}
+}
+
+func TestBuildAnalysisConditions(t *testing.T) {
+	testCases := []struct {
+		name     string
+		halted   bool
+		promoted bool
+	}{
+		{name: "progressing", halted: false, promoted: false},
+		{name: "promoted", halted: false, promoted: true},
+		{name: "halted", halted: true, promoted: false},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			conditions := buildAnalysisConditions(tc.halted, tc.promoted)
+			if len(conditions) != 3 {
+				t.Fatalf("expected 3 conditions, got %d", len(conditions))
+			}
+			for _, c := range conditions {
+				switch c.Type {
+				case CanaryAnalysisProgressingConditionType:
+					want := operatorv1.ConditionTrue
+					if tc.halted || tc.promoted {
+						want = operatorv1.ConditionFalse
+					}
+					if c.Status != want {
+						t.Errorf("expected %s=%s, got %s", c.Type, want, c.Status)
+					}
+				case CanaryAnalysisHaltedConditionType:
+					if c.Status != boolToConditionStatus(tc.halted) {
+						t.Errorf("expected %s=%s, got %s", c.Type, boolToConditionStatus(tc.halted), c.Status)
+					}
+				case CanaryAnalysisPromotedConditionType:
+					if c.Status != boolToConditionStatus(tc.promoted) {
+						t.Errorf("expected %s=%s, got %s", c.Type, boolToConditionStatus(tc.promoted), c.Status)
+					}
+				}
+			}
+		})
+	}
+}
+
+// TestRollbackRevertsDeploymentToLastKnownGoodTemplate verifies that
+// rollback actually reverts the router deployment's pod template to the
+// revision captureStableTemplate most recently observed, rather than
+// leaving the deployment's own rolling update strategy to keep progressing
+// toward the bad template.
+func TestRollbackRevertsDeploymentToLastKnownGoodTemplate(t *testing.T) {
+	scheme := runtime.NewScheme()
+	if err := routev1.Install(scheme); err != nil {
+		t.Fatalf("failed to install route/v1 scheme: %v", err)
+	}
+	if err := operatorv1.Install(scheme); err != nil {
+		t.Fatalf("failed to install operator/v1 scheme: %v", err)
+	}
+	if err := appsv1.AddToScheme(scheme); err != nil {
+		t.Fatalf("failed to install apps/v1 scheme: %v", err)
+	}
+
+	ic := &operatorv1.IngressController{
+		ObjectMeta: metav1.ObjectMeta{Name: "default", Namespace: "openshift-ingress-operator"},
+	}
+
+	routeName := controller.CanaryRouteName()
+	route := &routev1.Route{
+		ObjectMeta: metav1.ObjectMeta{Name: routeName.Name, Namespace: routeName.Namespace},
+	}
+
+	deploymentName := controller.RouterDeploymentName(ic)
+	goodTemplate := corev1.PodTemplateSpec{
+		Spec: corev1.PodSpec{Containers: []corev1.Container{{Name: "router", Image: "router:good"}}},
+	}
+	deployment := &appsv1.Deployment{
+		ObjectMeta: metav1.ObjectMeta{Name: deploymentName.Name, Namespace: deploymentName.Namespace},
+		Spec:       appsv1.DeploymentSpec{Template: goodTemplate},
+	}
+
+	cl := fakeclient.NewClientBuilder().WithScheme(scheme).WithObjects(route, deployment).Build()
+	c := &AnalysisController{
+		client:          cl,
+		stableTemplates: map[types.NamespacedName]corev1.PodTemplateSpec{},
+	}
+
+	ctx := context.Background()
+	if err := c.captureStableTemplate(ctx, ic); err != nil {
+		t.Fatalf("captureStableTemplate returned an error: %v", err)
+	}
+
+	// Simulate a bad rollout: the deployment's template has moved on to a
+	// new, broken image.
+	deployment.Spec.Template.Spec.Containers[0].Image = "router:bad"
+	if err := cl.Update(ctx, deployment); err != nil {
+		t.Fatalf("failed to simulate in-progress rollout: %v", err)
+	}
+
+	if err := c.rollback(ctx, ic); err != nil {
+		t.Fatalf("rollback returned an error: %v", err)
+	}
+
+	updated := &appsv1.Deployment{}
+	if err := cl.Get(ctx, deploymentName, updated); err != nil {
+		t.Fatalf("failed to get updated deployment: %v", err)
+	}
+	if got, want := updated.Spec.Template.Spec.Containers[0].Image, "router:good"; got != want {
+		t.Errorf("expected deployment template image %q after rollback, got %q", want, got)
+	}
+}
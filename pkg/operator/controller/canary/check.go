@@ -0,0 +1,136 @@
+package canary
+
+import (
+	"context"
+	"fmt"
+
+	operatorv1 "github.com/openshift/api/operator/v1"
+	routev1 "github.com/openshift/api/route/v1"
+
+	"github.com/openshift/cluster-ingress-operator/pkg/operator/controller"
+	ingresscontroller "github.com/openshift/cluster-ingress-operator/pkg/operator/controller/ingress"
+
+	appsv1 "k8s.io/api/apps/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// checkWindow is the number of most-recent probe runs considered when
+// deciding whether CanaryCheckSuccess should be true. A single flaky sample
+// should not flap the condition, but a probe that has failed across the
+// whole window should.
+const checkWindow = 3
+
+// probeHistory keeps the last checkWindow pass/fail results for one
+// configured probe so aggregateCheckResults can require every probe to have
+// passed across the window rather than just on the most recent sample.
+type probeHistory struct {
+	results []bool
+}
+
+func (h *probeHistory) record(passed bool) {
+	h.results = append(h.results, passed)
+	if len(h.results) > checkWindow {
+		h.results = h.results[len(h.results)-checkWindow:]
+	}
+}
+
+func (h *probeHistory) passedWindow() bool {
+	if len(h.results) < checkWindow {
+		return false
+	}
+	for _, ok := range h.results {
+		if !ok {
+			return false
+		}
+	}
+	return true
+}
+
+// aggregateCheckCondition builds the CanaryCheckSuccess condition from the
+// per-probe histories: it is only True when every configured probe has
+// passed on every sample in the window.
+func aggregateCheckCondition(histories map[string]*probeHistory) operatorv1.OperatorCondition {
+	status := operatorv1.ConditionTrue
+	for _, h := range histories {
+		if !h.passedWindow() {
+			status = operatorv1.ConditionFalse
+			break
+		}
+	}
+	return operatorv1.OperatorCondition{
+		Type:   ingresscontroller.IngressControllerCanaryCheckSuccessConditionType,
+		Status: status,
+	}
+}
+
+// CheckController runs the probes configured on Spec.CanaryProbes (or
+// DefaultProbes) against the cluster-wide canary route on every reconcile,
+// and maintains the CanaryCheckSuccess condition from the aggregate result
+// across the last checkWindow samples.
+type CheckController struct {
+	client     client.Client
+	kubeClient kubernetes.Interface
+
+	// histories is keyed by IngressController and then by probe index, since
+	// CanaryProbes has no separate identifier for an individual probe.
+	histories map[types.NamespacedName]map[int]*probeHistory
+}
+
+// NewCheckController returns a CheckController that uses cl for routes,
+// deployments, and status updates, and kubeClient to create and stream logs
+// from the probe pods the configured probes run in.
+func NewCheckController(cl client.Client, kubeClient kubernetes.Interface) *CheckController {
+	return &CheckController{
+		client:     cl,
+		kubeClient: kubeClient,
+		histories:  map[types.NamespacedName]map[int]*probeHistory{},
+	}
+}
+
+// Reconcile runs every probe configured on ic against the cluster-wide
+// canary route once, records the result into that probe's history, and
+// updates the CanaryCheckSuccess condition from the aggregate of all
+// probes' histories.
+func (c *CheckController) Reconcile(ctx context.Context, ic *operatorv1.IngressController) error {
+	route := &routev1.Route{}
+	if err := c.client.Get(ctx, controller.CanaryRouteName(), route); err != nil {
+		return fmt.Errorf("failed to get canary route: %w", err)
+	}
+
+	deployment := &appsv1.Deployment{}
+	if err := c.client.Get(ctx, controller.RouterDeploymentName(ic), deployment); err != nil {
+		return fmt.Errorf("failed to get router deployment for ingresscontroller %s: %w", ic.Name, err)
+	}
+	image := deployment.Spec.Template.Spec.Containers[0].Image
+
+	probes := ic.Spec.CanaryProbes
+	if len(probes) == 0 {
+		probes = DefaultProbes
+	}
+
+	results, _ := runConfiguredProbes(ctx, c.kubeClient, route.Namespace, image, route.Spec.Host, probes)
+
+	key := types.NamespacedName{Namespace: ic.Namespace, Name: ic.Name}
+	histories, ok := c.histories[key]
+	if !ok {
+		histories = map[int]*probeHistory{}
+		c.histories[key] = histories
+	}
+
+	byName := map[string]*probeHistory{}
+	for i, result := range results {
+		h, ok := histories[i]
+		if !ok {
+			h = &probeHistory{}
+			histories[i] = h
+		}
+		h.record(result.ok)
+		byName[fmt.Sprintf("probe-%d", i)] = h
+	}
+
+	updated := ic.DeepCopy()
+	setOperatorCondition(&updated.Status.Conditions, aggregateCheckCondition(byName))
+	return c.client.Status().Update(ctx, updated)
+}
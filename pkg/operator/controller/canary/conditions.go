@@ -0,0 +1,34 @@
+package canary
+
+import (
+	operatorv1 "github.com/openshift/api/operator/v1"
+)
+
+const (
+	// CanaryAnalysisProgressingConditionType indicates that a weighted
+	// canary analysis of a router rollout is in progress.
+	CanaryAnalysisProgressingConditionType = "CanaryProgressing"
+	// CanaryAnalysisPromotedConditionType indicates that the canary
+	// analysis reached the configured maxWeight and the rollout was
+	// promoted to receive all traffic.
+	CanaryAnalysisPromotedConditionType = "CanaryPromoted"
+	// CanaryAnalysisHaltedConditionType indicates that the canary
+	// analysis observed threshold consecutive failed samples and halted
+	// and rolled back the rollout.
+	CanaryAnalysisHaltedConditionType = "CanaryHalted"
+)
+
+// setOperatorCondition sets the given condition on conditions, replacing any
+// existing condition of the same type.
+func setOperatorCondition(conditions *[]operatorv1.OperatorCondition, condition operatorv1.OperatorCondition) {
+	if conditions == nil {
+		return
+	}
+	for i := range *conditions {
+		if (*conditions)[i].Type == condition.Type {
+			(*conditions)[i] = condition
+			return
+		}
+	}
+	*conditions = append(*conditions, condition)
+}
@@ -0,0 +1,165 @@
+package canary
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	operatorv1 "github.com/openshift/api/operator/v1"
+
+	kerrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/types"
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
+	"k8s.io/client-go/kubernetes"
+
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/manager"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+	"sigs.k8s.io/controller-runtime/pkg/source"
+)
+
+const controllerName = "canary_controller"
+
+// defaultResyncInterval bounds how long the canary check and per-endpoint
+// probes can go without running: analysis.Reconcile only asks to be
+// requeued while a rollout is in progress, and most IngressControllers
+// never configure CanaryAnalysis at all, so without a floor here the probes
+// this controller is responsible for would only ever run once per
+// generation change instead of on a recurring interval.
+const defaultResyncInterval = 30 * time.Second
+
+// Config bundles the canary controller's external dependencies that aren't
+// available from the manager itself.
+type Config struct {
+	// PrometheusURL is the address of the in-cluster Thanos/Prometheus
+	// query endpoint used to evaluate canary analysis metrics. It may be
+	// empty, in which case only synthetic curl probes are used.
+	PrometheusURL string
+}
+
+// reconciler reconciles IngressControllers to drive their canary analysis
+// and the aggregate CanaryCheckSuccess condition.
+type reconciler struct {
+	config    Config
+	client    client.Client
+	analysis  *AnalysisController
+	check     *CheckController
+	endpoints *EndpointController
+}
+
+// New creates and returns a controller that reconciles IngressControllers in
+// order to drive progressive weighted canary analysis for router rollouts
+// and the aggregate canary probe check. It is meant to be called from the
+// operator's existing manager bootstrap alongside the operator's other
+// controllers (ingress, DNS, certificate, etc.), the same way those
+// controllers' own New functions are; it does not construct or replace that
+// bootstrap itself.
+func New(mgr manager.Manager, config Config) (controller.Controller, error) {
+	kubeClient, err := kubernetes.NewForConfig(mgr.GetConfig())
+	if err != nil {
+		return nil, err
+	}
+
+	r := &reconciler{
+		config:    config,
+		client:    mgr.GetClient(),
+		analysis:  NewAnalysisController(mgr.GetClient(), kubeClient, config.PrometheusURL),
+		check:     NewCheckController(mgr.GetClient(), kubeClient),
+		endpoints: NewEndpointController(mgr.GetClient(), NewClientRouterPodLister(mgr.GetClient()), kubeClient),
+	}
+	c, err := controller.New(controllerName, mgr, controller.Options{Reconciler: r})
+	if err != nil {
+		return nil, err
+	}
+	if err := c.Watch(&source.Kind{Type: &operatorv1.IngressController{}}, &handler.EnqueueRequestForObject{}); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// Reconcile drives the canary check, per-endpoint probes, and canary
+// analysis for the IngressController named by request, and requeues on
+// defaultResyncInterval (or sooner, if the analysis's configured interval is
+// shorter) so the checks keep running on a recurring basis rather than only
+// on spec changes.
+func (r *reconciler) Reconcile(ctx context.Context, request reconcile.Request) (reconcile.Result, error) {
+	log.Info("reconciling", "request", request)
+
+	ic := &operatorv1.IngressController{}
+	if err := r.client.Get(ctx, request.NamespacedName, ic); err != nil {
+		if kerrors.IsNotFound(err) {
+			return reconcile.Result{}, nil
+		}
+		return reconcile.Result{}, err
+	}
+
+	// check, endpoints, and analysis each read and write IngressController
+	// Status independently. Re-fetch ic between stages so each stage's
+	// Status().Update() applies on top of the previous stage's write
+	// instead of racing it into a conflict against a stale snapshot, and
+	// run every stage even if an earlier one errors so one broken
+	// sub-controller can't prevent the others from updating status.
+	var errs []error
+
+	if err := r.check.Reconcile(ctx, ic); err != nil {
+		errs = append(errs, fmt.Errorf("failed to reconcile canary check: %w", err))
+	}
+	if gone, err := r.refetch(ctx, request.NamespacedName, ic); err != nil {
+		errs = append(errs, err)
+	} else if gone {
+		return reconcile.Result{}, utilerrors.NewAggregate(errs)
+	}
+
+	if err := r.endpoints.Reconcile(ctx, ic); err != nil {
+		errs = append(errs, fmt.Errorf("failed to reconcile canary endpoints: %w", err))
+	}
+	if gone, err := r.refetch(ctx, request.NamespacedName, ic); err != nil {
+		errs = append(errs, err)
+	} else if gone {
+		return reconcile.Result{}, utilerrors.NewAggregate(errs)
+	}
+
+	requeueAfter, err := r.analysis.Reconcile(ctx, ic, routerRolloutInProgress(ic))
+	if err != nil {
+		errs = append(errs, fmt.Errorf("failed to reconcile canary analysis: %w", err))
+	}
+
+	return reconcile.Result{RequeueAfter: boundRequeueAfter(requeueAfter)}, utilerrors.NewAggregate(errs)
+}
+
+// boundRequeueAfter clamps requeueAfter to at most defaultResyncInterval,
+// and replaces a non-positive value (analysis.Reconcile returns 0 whenever
+// no rollout is in progress) with defaultResyncInterval outright, so the
+// canary check and per-endpoint probes this controller also drives keep
+// running on a recurring basis instead of only on spec changes. It is a
+// pure function so the bound can be unit tested without a fake client.
+func boundRequeueAfter(requeueAfter time.Duration) time.Duration {
+	if requeueAfter <= 0 || requeueAfter > defaultResyncInterval {
+		return defaultResyncInterval
+	}
+	return requeueAfter
+}
+
+// refetch re-reads ic from the API server into ic, reporting gone=true if it
+// has been deleted since the last read instead of treating that as an error.
+func (r *reconciler) refetch(ctx context.Context, name types.NamespacedName, ic *operatorv1.IngressController) (gone bool, err error) {
+	if err := r.client.Get(ctx, name, ic); err != nil {
+		if kerrors.IsNotFound(err) {
+			return true, nil
+		}
+		return false, err
+	}
+	return false, nil
+}
+
+// routerRolloutInProgress reports whether ic's router deployment has a
+// revision rollout in progress that canary analysis should be driving. The
+// operator bumps ObservedGeneration once it has driven the IngressController
+// spec all the way through to a reconciled router deployment, so a mismatch
+// against Generation means a new spec (and likely a new router image or
+// config) is still being rolled out.
+func routerRolloutInProgress(ic *operatorv1.IngressController) bool {
+	return ic.Status.ObservedGeneration != ic.Generation
+}
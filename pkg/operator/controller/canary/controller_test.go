@@ -0,0 +1,80 @@
+package canary
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	operatorv1 "github.com/openshift/api/operator/v1"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	fakeclient "sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func TestBoundRequeueAfter(t *testing.T) {
+	testCases := []struct {
+		name          string
+		requeueAfter  time.Duration
+		expectRequeue time.Duration
+	}{
+		{
+			name:          "zero is replaced with the default resync interval",
+			requeueAfter:  0,
+			expectRequeue: defaultResyncInterval,
+		},
+		{
+			name:          "negative is replaced with the default resync interval",
+			requeueAfter:  -1 * time.Second,
+			expectRequeue: defaultResyncInterval,
+		},
+		{
+			name:          "a shorter analysis interval is preserved",
+			requeueAfter:  5 * time.Second,
+			expectRequeue: 5 * time.Second,
+		},
+		{
+			name:          "a longer analysis interval is capped at the default resync interval",
+			requeueAfter:  5 * time.Minute,
+			expectRequeue: defaultResyncInterval,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := boundRequeueAfter(tc.requeueAfter); got != tc.expectRequeue {
+				t.Errorf("expected %s, got %s", tc.expectRequeue, got)
+			}
+		})
+	}
+}
+
+func TestRefetchReportsGoneOnNotFound(t *testing.T) {
+	scheme := runtime.NewScheme()
+	if err := operatorv1.Install(scheme); err != nil {
+		t.Fatalf("failed to install operator/v1 scheme: %v", err)
+	}
+
+	name := types.NamespacedName{Namespace: "openshift-ingress-operator", Name: "default"}
+	ic := &operatorv1.IngressController{ObjectMeta: metav1.ObjectMeta{Name: name.Name, Namespace: name.Namespace}}
+
+	cl := fakeclient.NewClientBuilder().WithScheme(scheme).WithObjects(ic).Build()
+	r := &reconciler{client: cl}
+
+	if gone, err := r.refetch(context.Background(), name, ic); err != nil || gone {
+		t.Fatalf("expected gone=false, err=nil for an existing object, got gone=%v, err=%v", gone, err)
+	}
+
+	if err := cl.Delete(context.Background(), ic); err != nil {
+		t.Fatalf("failed to delete ingresscontroller: %v", err)
+	}
+
+	gone, err := r.refetch(context.Background(), name, ic)
+	if err != nil {
+		t.Fatalf("expected no error for a deleted object, got: %v", err)
+	}
+	if !gone {
+		t.Errorf("expected gone=true for a deleted object")
+	}
+}
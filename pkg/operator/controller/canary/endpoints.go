@@ -0,0 +1,324 @@
+package canary
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	operatorv1 "github.com/openshift/api/operator/v1"
+	routev1 "github.com/openshift/api/route/v1"
+
+	"github.com/openshift/cluster-ingress-operator/pkg/operator/controller"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	kerrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"k8s.io/client-go/kubernetes"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// shardCanaryServicePort is the router's plaintext HTTP backend port, which
+// is what the per-endpoint Service and Route created below target. It
+// matches the port the router container itself listens on for insecure
+// (non-TLS-terminated) traffic.
+const shardCanaryServicePort = 8080
+
+// CanaryEndpointDegradedConditionType indicates that at least one router
+// pod endpoint's canary probe has been failing for longer than the
+// configured grace period, pinpointing a bad node or zone rather than only
+// surfacing a single cluster-wide boolean.
+const CanaryEndpointDegradedConditionType = "CanaryEndpointDegraded"
+
+// defaultEndpointDegradedGracePeriod is used when an IngressController does
+// not set Spec.CanaryEndpointDegradedGracePeriod.
+const defaultEndpointDegradedGracePeriod = 2 * time.Minute
+
+// routerPodLister is the subset of the kube client EndpointController needs
+// to enumerate the router pods backing an ingress controller's deployment
+// directly, analogous to how a client enumerates a Service's pods by label
+// selector rather than going through the Service's VIP.
+type routerPodLister interface {
+	ListRouterPods(ctx context.Context, ic *operatorv1.IngressController) ([]corev1.Pod, error)
+}
+
+// clientRouterPodLister is the production routerPodLister: it lists the
+// Pods backing ic's router Deployment by the deployment's own pod template
+// label selector, the same selector the Deployment's ReplicaSets use.
+type clientRouterPodLister struct {
+	client client.Client
+}
+
+// NewClientRouterPodLister returns a routerPodLister backed by cl.
+func NewClientRouterPodLister(cl client.Client) routerPodLister {
+	return &clientRouterPodLister{client: cl}
+}
+
+func (l *clientRouterPodLister) ListRouterPods(ctx context.Context, ic *operatorv1.IngressController) ([]corev1.Pod, error) {
+	deployment := &appsv1.Deployment{}
+	if err := l.client.Get(ctx, controller.RouterDeploymentName(ic), deployment); err != nil {
+		return nil, fmt.Errorf("failed to get router deployment: %w", err)
+	}
+
+	selector, err := metav1.LabelSelectorAsSelector(deployment.Spec.Selector)
+	if err != nil {
+		return nil, fmt.Errorf("failed to convert router deployment selector: %w", err)
+	}
+
+	var pods corev1.PodList
+	if err := l.client.List(ctx, &pods, client.InNamespace(deployment.Namespace), client.MatchingLabelsSelector{Selector: selector}); err != nil {
+		return nil, fmt.Errorf("failed to list router pods: %w", err)
+	}
+	return pods.Items, nil
+}
+
+// EndpointController reconciles one canary route per ingress controller
+// shard and per router pod endpoint, probing each router pod directly
+// (bypassing the service VIP) and publishing per-endpoint health onto
+// IngressController.Status.CanaryEndpoints.
+type EndpointController struct {
+	client     client.Client
+	pods       routerPodLister
+	kubeClient kubernetes.Interface
+
+	// failureSince tracks, per router pod (keyed by the ingresscontroller's
+	// namespace and the pod's name), when that pod's canary probe first
+	// started failing, so a grace period can be applied before flipping
+	// CanaryEndpointDegraded.
+	failureSince map[types.NamespacedName]time.Time
+}
+
+// NewEndpointController returns an EndpointController that uses cl for the
+// per-shard canary routes and status updates, pods to enumerate router pods,
+// and kubeClient to run the curl probe pods that check each endpoint.
+func NewEndpointController(cl client.Client, pods routerPodLister, kubeClient kubernetes.Interface) *EndpointController {
+	return &EndpointController{
+		client:       cl,
+		pods:         pods,
+		kubeClient:   kubeClient,
+		failureSince: map[types.NamespacedName]time.Time{},
+	}
+}
+
+// ShardCanaryRouteName returns the name of the per-shard, per-endpoint
+// canary route for ic and the given router pod name, extending
+// controller.CanaryRouteName (formerly a single cluster-wide canary route)
+// to one route per shard per endpoint.
+func ShardCanaryRouteName(ic *operatorv1.IngressController, podName string) types.NamespacedName {
+	base := controller.CanaryRouteName()
+	return types.NamespacedName{
+		Namespace: base.Namespace,
+		Name:      fmt.Sprintf("%s-%s-%s", base.Name, ic.Name, podName),
+	}
+}
+
+// Reconcile probes every router pod endpoint for ic directly, records the
+// result onto Status.CanaryEndpoints, and flips CanaryEndpointDegraded when
+// any endpoint has been failing longer than the configured grace period.
+func (c *EndpointController) Reconcile(ctx context.Context, ic *operatorv1.IngressController) error {
+	pods, err := c.pods.ListRouterPods(ctx, ic)
+	if err != nil {
+		return fmt.Errorf("failed to list router pods for ingresscontroller %s: %w", ic.Name, err)
+	}
+
+	deployment := &appsv1.Deployment{}
+	if err := c.client.Get(ctx, controller.RouterDeploymentName(ic), deployment); err != nil {
+		return fmt.Errorf("failed to get router deployment for ingresscontroller %s: %w", ic.Name, err)
+	}
+	image := deployment.Spec.Template.Spec.Containers[0].Image
+
+	gracePeriod := defaultEndpointDegradedGracePeriod
+	if ic.Spec.CanaryEndpointDegradedGracePeriod.Duration > 0 {
+		gracePeriod = ic.Spec.CanaryEndpointDegradedGracePeriod.Duration
+	}
+
+	now := timeNow()
+	statuses := make([]operatorv1.CanaryEndpointStatus, 0, len(pods))
+	degraded := false
+	for _, pod := range pods {
+		key := types.NamespacedName{Namespace: ic.Namespace, Name: pod.Name}
+
+		status, err := c.probeEndpoint(ctx, ic, pod, image)
+		if err != nil {
+			return fmt.Errorf("failed to probe router pod %s/%s: %w", pod.Namespace, pod.Name, err)
+		}
+
+		if status.OK {
+			delete(c.failureSince, key)
+		} else {
+			start, failing := c.failureSince[key]
+			if !failing {
+				start = now
+				c.failureSince[key] = start
+			}
+			if isEndpointDegraded(start, now, gracePeriod) {
+				degraded = true
+			}
+		}
+
+		statuses = append(statuses, status)
+	}
+
+	updated := ic.DeepCopy()
+	updated.Status.CanaryEndpoints = statuses
+	setOperatorCondition(&updated.Status.Conditions, operatorv1.OperatorCondition{
+		Type:   CanaryEndpointDegradedConditionType,
+		Status: boolToConditionStatus(degraded),
+	})
+	return c.client.Status().Update(ctx, updated)
+}
+
+// isEndpointDegraded reports whether an endpoint that has been failing
+// since failingSince should be considered degraded as of now, given
+// gracePeriod. It is a pure function so the grace-period arithmetic can be
+// unit tested without a fake client or prober.
+func isEndpointDegraded(failingSince, now time.Time, gracePeriod time.Duration) bool {
+	return now.Sub(failingSince) >= gracePeriod
+}
+
+// probeEndpoint curls pod directly through its own per-shard, per-endpoint
+// canary route, whose host resolves only to that pod, rather than the
+// router's service VIP or the single cluster-wide canary route. That way a
+// single bad node or zone shows up as one failing endpoint instead of
+// uniformly passing or failing the whole aggregate canary check.
+func (c *EndpointController) probeEndpoint(ctx context.Context, ic *operatorv1.IngressController, pod corev1.Pod, image string) (operatorv1.CanaryEndpointStatus, error) {
+	route, err := c.ensureShardCanaryRoute(ctx, ic, pod)
+	if err != nil {
+		return operatorv1.CanaryEndpointStatus{}, err
+	}
+
+	probes := ic.Spec.CanaryProbes
+	if len(probes) == 0 {
+		probes = DefaultProbes
+	}
+
+	start := timeNow()
+	results, ok := runConfiguredProbes(ctx, c.kubeClient, route.Namespace, image, route.Spec.Host, probes)
+	latency := timeNow().Sub(start)
+
+	status := operatorv1.CanaryEndpointStatus{
+		RouterPod:     pod.Name,
+		Node:          pod.Spec.NodeName,
+		Zone:          pod.Labels[corev1.LabelTopologyZone],
+		LastProbeTime: metav1.NewTime(timeNow()),
+		LatencyMs:     latency.Milliseconds(),
+		OK:            ok,
+	}
+	if !ok {
+		status.Message = firstFailureMessage(results)
+	}
+	return status, nil
+}
+
+// firstFailureMessage summarizes the first failed probe result for
+// CanaryEndpointStatus.Message.
+func firstFailureMessage(results []probeResult) string {
+	for i, r := range results {
+		if r.ok {
+			continue
+		}
+		if r.err != nil {
+			return fmt.Sprintf("probe %d: %v", i, r.err)
+		}
+		return fmt.Sprintf("probe %d did not satisfy its configured assertions", i)
+	}
+	return ""
+}
+
+// ensureShardCanaryRoute ensures the per-shard, per-endpoint Service, manual
+// Endpoints, and Route named by ShardCanaryRouteName all exist, creating any
+// of the three that are missing and correcting the Endpoints when they do
+// not point at exactly pod's IP, and returns the resulting Route. An existing
+// Service or Route is used as it is. Nothing else in the operator
+// creates these: a router pod has no label unique to itself, so a regular
+// selector-based Service can't be used to front exactly one pod. Instead the
+// Service has no selector at all, and the Endpoints object is managed
+// directly with pod's IP, the same technique used for Services that front an
+// external, non-pod-selected backend.
+func (c *EndpointController) ensureShardCanaryRoute(ctx context.Context, ic *operatorv1.IngressController, pod corev1.Pod) (*routev1.Route, error) {
+	name := ShardCanaryRouteName(ic, pod.Name)
+
+	if err := c.ensureShardCanaryService(ctx, name); err != nil {
+		return nil, fmt.Errorf("failed to ensure shard canary service for pod %s: %w", pod.Name, err)
+	}
+	if err := c.ensureShardCanaryEndpoints(ctx, name, pod); err != nil {
+		return nil, fmt.Errorf("failed to ensure shard canary endpoints for pod %s: %w", pod.Name, err)
+	}
+
+	route := &routev1.Route{}
+	err := c.client.Get(ctx, name, route)
+	if err == nil {
+		return route, nil
+	}
+	if !kerrors.IsNotFound(err) {
+		return nil, fmt.Errorf("failed to get shard canary route for pod %s: %w", pod.Name, err)
+	}
+
+	route = &routev1.Route{
+		ObjectMeta: metav1.ObjectMeta{Name: name.Name, Namespace: name.Namespace},
+		Spec: routev1.RouteSpec{
+			To: routev1.RouteTargetReference{Kind: "Service", Name: name.Name},
+		},
+	}
+	if err := c.client.Create(ctx, route); err != nil {
+		return nil, fmt.Errorf("failed to create shard canary route for pod %s: %w", pod.Name, err)
+	}
+	return route, nil
+}
+
+// ensureShardCanaryService ensures a selector-less Service named name exists,
+// ready for ensureShardCanaryEndpoints to point at a single router pod.
+func (c *EndpointController) ensureShardCanaryService(ctx context.Context, name types.NamespacedName) error {
+	svc := &corev1.Service{}
+	err := c.client.Get(ctx, name, svc)
+	if err == nil {
+		return nil
+	}
+	if !kerrors.IsNotFound(err) {
+		return err
+	}
+
+	svc = &corev1.Service{
+		ObjectMeta: metav1.ObjectMeta{Name: name.Name, Namespace: name.Namespace},
+		Spec: corev1.ServiceSpec{
+			Ports: []corev1.ServicePort{{
+				Name:       "http",
+				Port:       shardCanaryServicePort,
+				TargetPort: intstr.FromInt(shardCanaryServicePort),
+			}},
+		},
+	}
+	return c.client.Create(ctx, svc)
+}
+
+// ensureShardCanaryEndpoints ensures the manually-managed Endpoints for name
+// point at exactly pod's IP, creating or correcting them as needed.
+func (c *EndpointController) ensureShardCanaryEndpoints(ctx context.Context, name types.NamespacedName, pod corev1.Pod) error {
+	if pod.Status.PodIP == "" {
+		return fmt.Errorf("router pod %s has no assigned IP yet", pod.Name)
+	}
+
+	desiredAddresses := []corev1.EndpointAddress{{IP: pod.Status.PodIP}}
+	desiredPorts := []corev1.EndpointPort{{Name: "http", Port: shardCanaryServicePort}}
+
+	endpoints := &corev1.Endpoints{}
+	err := c.client.Get(ctx, name, endpoints)
+	if kerrors.IsNotFound(err) {
+		endpoints = &corev1.Endpoints{
+			ObjectMeta: metav1.ObjectMeta{Name: name.Name, Namespace: name.Namespace},
+			Subsets:    []corev1.EndpointSubset{{Addresses: desiredAddresses, Ports: desiredPorts}},
+		}
+		return c.client.Create(ctx, endpoints)
+	}
+	if err != nil {
+		return err
+	}
+
+	if len(endpoints.Subsets) == 1 && len(endpoints.Subsets[0].Addresses) == 1 && endpoints.Subsets[0].Addresses[0].IP == pod.Status.PodIP {
+		return nil
+	}
+	endpoints.Subsets = []corev1.EndpointSubset{{Addresses: desiredAddresses, Ports: desiredPorts}}
+	return c.client.Update(ctx, endpoints)
+}
@@ -0,0 +1,195 @@
+package canary
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	operatorv1 "github.com/openshift/api/operator/v1"
+	routev1 "github.com/openshift/api/route/v1"
+
+	"github.com/openshift/cluster-ingress-operator/pkg/operator/controller"
+
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+
+	fakeclient "sigs.k8s.io/controller-runtime/pkg/client/fake"
+)
+
+func TestIsEndpointDegraded(t *testing.T) {
+	now := time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC)
+	gracePeriod := 2 * time.Minute
+
+	testCases := []struct {
+		name         string
+		failingSince time.Time
+		expect       bool
+	}{
+		{
+			name:         "just started failing",
+			failingSince: now,
+			expect:       false,
+		},
+		{
+			name:         "failing for less than the grace period",
+			failingSince: now.Add(-1 * time.Minute),
+			expect:       false,
+		},
+		{
+			name:         "failing for exactly the grace period",
+			failingSince: now.Add(-2 * time.Minute),
+			expect:       true,
+		},
+		{
+			name:         "failing for longer than the grace period",
+			failingSince: now.Add(-10 * time.Minute),
+			expect:       true,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := isEndpointDegraded(tc.failingSince, now, gracePeriod); got != tc.expect {
+				t.Errorf("expected %v, got %v", tc.expect, got)
+			}
+		})
+	}
+}
+
+func TestShardCanaryRouteName(t *testing.T) {
+	ic := &operatorv1.IngressController{
+		ObjectMeta: metav1.ObjectMeta{Name: "shard-a", Namespace: "openshift-ingress-operator"},
+	}
+
+	name := ShardCanaryRouteName(ic, "router-pod-1")
+	if name.Name == "" {
+		t.Fatalf("expected a non-empty shard canary route name")
+	}
+
+	other := ShardCanaryRouteName(ic, "router-pod-2")
+	if name.Name == other.Name {
+		t.Errorf("expected distinct canary route names for distinct router pods, got %q for both", name.Name)
+	}
+}
+
+// TestClientRouterPodListerListsOnlyRouterPods verifies that
+// clientRouterPodLister lists the pods matching the router deployment's own
+// selector, and nothing else, so EndpointController probes each actual
+// router pod directly rather than a service VIP.
+func TestClientRouterPodListerListsOnlyRouterPods(t *testing.T) {
+	scheme := runtime.NewScheme()
+	if err := routev1.Install(scheme); err != nil {
+		t.Fatalf("failed to install route/v1 scheme: %v", err)
+	}
+	if err := operatorv1.Install(scheme); err != nil {
+		t.Fatalf("failed to install operator/v1 scheme: %v", err)
+	}
+	if err := appsv1.AddToScheme(scheme); err != nil {
+		t.Fatalf("failed to install apps/v1 scheme: %v", err)
+	}
+	if err := corev1.AddToScheme(scheme); err != nil {
+		t.Fatalf("failed to install core/v1 scheme: %v", err)
+	}
+
+	ic := &operatorv1.IngressController{
+		ObjectMeta: metav1.ObjectMeta{Name: "default", Namespace: "openshift-ingress-operator"},
+	}
+
+	deploymentName := controller.RouterDeploymentName(ic)
+	routerLabels := map[string]string{"ingresscontroller.operator.openshift.io/deployment-ingresscontroller": "default"}
+	deployment := &appsv1.Deployment{
+		ObjectMeta: metav1.ObjectMeta{Name: deploymentName.Name, Namespace: deploymentName.Namespace},
+		Spec: appsv1.DeploymentSpec{
+			Selector: &metav1.LabelSelector{MatchLabels: routerLabels},
+		},
+	}
+
+	routerPod := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Name: "router-default-1", Namespace: deploymentName.Namespace, Labels: routerLabels},
+	}
+	otherPod := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Name: "unrelated-pod", Namespace: deploymentName.Namespace, Labels: map[string]string{"app": "unrelated"}},
+	}
+
+	cl := fakeclient.NewClientBuilder().WithScheme(scheme).WithObjects(deployment, routerPod, otherPod).Build()
+	lister := NewClientRouterPodLister(cl)
+
+	pods, err := lister.ListRouterPods(context.Background(), ic)
+	if err != nil {
+		t.Fatalf("ListRouterPods returned an error: %v", err)
+	}
+
+	if len(pods) != 1 {
+		t.Fatalf("expected exactly one router pod, got %d", len(pods))
+	}
+	if pods[0].Name != routerPod.Name {
+		t.Errorf("expected router pod %q, got %q", routerPod.Name, pods[0].Name)
+	}
+}
+
+// TestEnsureShardCanaryRouteCreatesServiceEndpointsAndRoute verifies that
+// ensureShardCanaryRoute creates the per-endpoint Service, manually-managed
+// Endpoints, and Route for a router pod when none of them exist yet, rather
+// than assuming they already do.
+func TestEnsureShardCanaryRouteCreatesServiceEndpointsAndRoute(t *testing.T) {
+	scheme := runtime.NewScheme()
+	if err := routev1.Install(scheme); err != nil {
+		t.Fatalf("failed to install route/v1 scheme: %v", err)
+	}
+	if err := operatorv1.Install(scheme); err != nil {
+		t.Fatalf("failed to install operator/v1 scheme: %v", err)
+	}
+	if err := corev1.AddToScheme(scheme); err != nil {
+		t.Fatalf("failed to install core/v1 scheme: %v", err)
+	}
+
+	ic := &operatorv1.IngressController{
+		ObjectMeta: metav1.ObjectMeta{Name: "default", Namespace: "openshift-ingress-operator"},
+	}
+	pod := corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Name: "router-default-1", Namespace: "openshift-ingress"},
+		Status:     corev1.PodStatus{PodIP: "10.0.0.5"},
+	}
+
+	cl := fakeclient.NewClientBuilder().WithScheme(scheme).Build()
+	c := &EndpointController{client: cl}
+
+	route, err := c.ensureShardCanaryRoute(context.Background(), ic, pod)
+	if err != nil {
+		t.Fatalf("ensureShardCanaryRoute returned an error: %v", err)
+	}
+
+	name := ShardCanaryRouteName(ic, pod.Name)
+	if route.Name != name.Name || route.Namespace != name.Namespace {
+		t.Errorf("expected route %s, got %s/%s", name, route.Namespace, route.Name)
+	}
+
+	svc := &corev1.Service{}
+	if err := cl.Get(context.Background(), name, svc); err != nil {
+		t.Fatalf("expected shard canary service to be created: %v", err)
+	}
+
+	endpoints := &corev1.Endpoints{}
+	if err := cl.Get(context.Background(), name, endpoints); err != nil {
+		t.Fatalf("expected shard canary endpoints to be created: %v", err)
+	}
+	if len(endpoints.Subsets) != 1 || len(endpoints.Subsets[0].Addresses) != 1 || endpoints.Subsets[0].Addresses[0].IP != pod.Status.PodIP {
+		t.Errorf("expected endpoints to point at pod IP %q, got %+v", pod.Status.PodIP, endpoints.Subsets)
+	}
+
+	// Calling it again with a different pod IP (e.g. after a pod restart)
+	// should correct the existing Endpoints rather than erroring on
+	// already-exists or leaving them stale.
+	pod.Status.PodIP = "10.0.0.6"
+	if _, err := c.ensureShardCanaryRoute(context.Background(), ic, pod); err != nil {
+		t.Fatalf("ensureShardCanaryRoute returned an error on the second call: %v", err)
+	}
+	if err := cl.Get(context.Background(), name, endpoints); err != nil {
+		t.Fatalf("failed to get endpoints after second call: %v", err)
+	}
+	if endpoints.Subsets[0].Addresses[0].IP != pod.Status.PodIP {
+		t.Errorf("expected endpoints to be updated to pod IP %q, got %q", pod.Status.PodIP, endpoints.Subsets[0].Addresses[0].IP)
+	}
+}
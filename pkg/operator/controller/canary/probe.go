@@ -0,0 +1,94 @@
+package canary
+
+import (
+	"context"
+	"fmt"
+
+	promapi "github.com/prometheus/client_golang/api"
+	promv1 "github.com/prometheus/client_golang/api/prometheus/v1"
+
+	operatorv1 "github.com/openshift/api/operator/v1"
+
+	"github.com/openshift/cluster-ingress-operator/pkg/operator/controller"
+
+	appsv1 "k8s.io/api/apps/v1"
+	"k8s.io/client-go/kubernetes"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// canaryProber evaluates whether the canary's current traffic slice is
+// meeting the configured SLO for the given metrics.
+type canaryProber interface {
+	Check(ctx context.Context, ic *operatorv1.IngressController, metrics []operatorv1.CanaryMetric) (bool, error)
+}
+
+// fallbackProber prefers querying the in-cluster Prometheus for HAProxy
+// metrics scraped from the canary's router pods, and falls back to running
+// the configured synthetic curl probes (the same runConfiguredProbes
+// machinery CheckController and EndpointController use) against the
+// cluster-wide canary route when Prometheus can't be reached.
+type fallbackProber struct {
+	client     client.Client
+	kubeClient kubernetes.Interface
+	promURL    string
+}
+
+func newFallbackProber(cl client.Client, kubeClient kubernetes.Interface, promURL string) *fallbackProber {
+	return &fallbackProber{client: cl, kubeClient: kubeClient, promURL: promURL}
+}
+
+func (p *fallbackProber) Check(ctx context.Context, ic *operatorv1.IngressController, metrics []operatorv1.CanaryMetric) (bool, error) {
+	if p.promURL != "" {
+		ok, err := p.checkWithPrometheus(ctx, ic, metrics)
+		if err == nil {
+			return ok, nil
+		}
+		// Prometheus is unavailable (monitoring stack down, scrape gap,
+		// etc.); fall through to the synthetic probe rather than failing
+		// the analysis outright.
+	}
+	return p.checkWithCurl(ctx, ic)
+}
+
+func (p *fallbackProber) checkWithPrometheus(ctx context.Context, ic *operatorv1.IngressController, metrics []operatorv1.CanaryMetric) (bool, error) {
+	promClient, err := promapi.NewClient(promapi.Config{Address: p.promURL})
+	if err != nil {
+		return false, fmt.Errorf("failed to create prometheus client: %w", err)
+	}
+	api := promv1.NewAPI(promClient)
+
+	for _, m := range metrics {
+		result, warnings, err := api.Query(ctx, m.Query, timeNow())
+		if err != nil {
+			return false, fmt.Errorf("failed to query prometheus for metric %q: %w", m.Name, err)
+		}
+		if len(warnings) > 0 {
+			log.Info("prometheus query returned warnings", "metric", m.Name, "warnings", warnings)
+		}
+		if !metricWithinThreshold(result, m) {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+func (p *fallbackProber) checkWithCurl(ctx context.Context, ic *operatorv1.IngressController) (bool, error) {
+	route, err := canaryRoute(ctx, p.client)
+	if err != nil {
+		return false, err
+	}
+
+	deployment := &appsv1.Deployment{}
+	if err := p.client.Get(ctx, controller.RouterDeploymentName(ic), deployment); err != nil {
+		return false, fmt.Errorf("failed to get router deployment for ingresscontroller %s: %w", ic.Name, err)
+	}
+	image := deployment.Spec.Template.Spec.Containers[0].Image
+
+	probes := ic.Spec.CanaryProbes
+	if len(probes) == 0 {
+		probes = DefaultProbes
+	}
+
+	_, ok := runConfiguredProbes(ctx, p.kubeClient, route.Namespace, image, route.Spec.Host, probes)
+	return ok, nil
+}
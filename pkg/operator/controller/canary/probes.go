@@ -0,0 +1,296 @@
+package canary
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	operatorv1 "github.com/openshift/api/operator/v1"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/kubernetes"
+)
+
+// DefaultProbes is used when an IngressController does not configure
+// Spec.CanaryProbes, preserving today's behavior of a single plaintext HTTP
+// GET that expects a 200 response carrying the hello-openshift echo body and
+// an x-request-port header. It is exported so e2e tests can exercise the
+// same default probe set the controller falls back to.
+var DefaultProbes = []operatorv1.CanaryProbe{
+	{
+		Scheme: operatorv1.CanaryProbeSchemeHTTP,
+		Method: "GET",
+		ExpectedStatusCodes: []int32{200},
+		ExpectedHeaders:     []operatorv1.CanaryProbeHeaderAssertion{{Name: "x-request-port", ValueRegex: ".*"}},
+		BodyRegex:           "Hello OpenShift!",
+	},
+}
+
+// probeResult is the outcome of running a single configured probe once.
+type probeResult struct {
+	probe operatorv1.CanaryProbe
+	ok    bool
+	err   error
+}
+
+// runConfiguredProbes runs every probe in probes (or DefaultProbes if probes
+// is empty) against host, and reports whether every probe
+// passed. A probe is retried up to its configured RetryPolicy before being
+// counted as failed.
+func runConfiguredProbes(ctx context.Context, kubeClient kubernetes.Interface, podNamespace, podImage, host string, probes []operatorv1.CanaryProbe) ([]probeResult, bool) {
+	if len(probes) == 0 {
+		probes = DefaultProbes
+	}
+
+	results := make([]probeResult, 0, len(probes))
+	allPassed := true
+	for i, probe := range probes {
+		ok, err := runProbeWithRetry(ctx, kubeClient, podNamespace, podImage, fmt.Sprintf("canary-probe-%d", i), host, probe)
+		results = append(results, probeResult{probe: probe, ok: ok, err: err})
+		if !ok {
+			allPassed = false
+		}
+	}
+	return results, allPassed
+}
+
+func runProbeWithRetry(ctx context.Context, kubeClient kubernetes.Interface, namespace, image, name, host string, probe operatorv1.CanaryProbe) (bool, error) {
+	attempts := probe.RetryPolicy.MaxRetries + 1
+	if attempts < 1 {
+		attempts = 1
+	}
+
+	var lastErr error
+	for attempt := int32(0); attempt < attempts; attempt++ {
+		// Each attempt gets its own pod name: reusing one name across
+		// retries would race a still-terminating pod from the previous
+		// attempt's delete against this attempt's create, failing the
+		// retry with AlreadyExists instead of actually retrying the probe.
+		ok, err := runProbeOnce(ctx, kubeClient, namespace, image, probeAttemptPodName(name, attempt), host, probe)
+		if ok {
+			return true, nil
+		}
+		lastErr = err
+	}
+	return false, lastErr
+}
+
+// probeAttemptPodName returns the pod name to use for the given retry
+// attempt of a probe, so a retry never reuses an earlier attempt's pod name.
+func probeAttemptPodName(name string, attempt int32) string {
+	return fmt.Sprintf("%s-%d", name, attempt)
+}
+
+func runProbeOnce(ctx context.Context, kubeClient kubernetes.Interface, namespace, image, name, host string, probe operatorv1.CanaryProbe) (bool, error) {
+	pod := BuildCanaryProbePod(name, namespace, image, host, probe)
+	client := kubeClient.CoreV1()
+	if _, err := client.Pods(namespace).Create(ctx, pod, metav1.CreateOptions{}); err != nil {
+		return false, fmt.Errorf("failed to create probe pod %s/%s: %w", namespace, name, err)
+	}
+	defer func() {
+		_ = client.Pods(namespace).Delete(ctx, name, metav1.DeleteOptions{})
+	}()
+
+	var output string
+	err := pollLogsUntilComplete(ctx, kubeClient, namespace, name, probe.Timeout.Duration, func(line string) bool {
+		output += line + "\n"
+		return false
+	})
+	if err != nil {
+		return false, err
+	}
+
+	return AssertProbeOutput(output, probe)
+}
+
+// AssertProbeOutput checks output (the curl -v transcript) against the
+// status code, header, and body assertions configured on probe. It is
+// exported so e2e tests can reuse the same assertion logic the controller
+// uses.
+func AssertProbeOutput(output string, probe operatorv1.CanaryProbe) (bool, error) {
+	if len(probe.ExpectedStatusCodes) > 0 {
+		if !containsExpectedStatus(output, probe.ExpectedStatusCodes) {
+			return false, nil
+		}
+	}
+
+	for _, h := range probe.ExpectedHeaders {
+		if !headerMatches(output, h.Name, h.ValueRegex) {
+			return false, nil
+		}
+	}
+
+	if probe.BodyRegex != "" {
+		re, err := regexp.Compile(probe.BodyRegex)
+		if err != nil {
+			return false, fmt.Errorf("invalid bodyRegex %q: %w", probe.BodyRegex, err)
+		}
+		if !re.MatchString(output) {
+			return false, nil
+		}
+	}
+
+	return true, nil
+}
+
+func containsExpectedStatus(output string, codes []int32) bool {
+	for _, line := range strings.Split(output, "\n") {
+		if !strings.HasPrefix(strings.TrimSpace(line), "< HTTP") {
+			continue
+		}
+		fields := strings.Fields(line)
+		if len(fields) < 3 {
+			continue
+		}
+		status, err := strconv.Atoi(fields[2])
+		if err != nil {
+			continue
+		}
+		for _, code := range codes {
+			if int32(status) == code {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func headerMatches(output, name, valueRegex string) bool {
+	re, err := regexp.Compile("(?i)^" + regexp.QuoteMeta(name) + ":\\s*" + valueRegex)
+	if err != nil {
+		return false
+	}
+	scanner := bufio.NewScanner(strings.NewReader(output))
+	for scanner.Scan() {
+		line := strings.TrimPrefix(strings.TrimSpace(scanner.Text()), "< ")
+		if re.MatchString(line) {
+			return true
+		}
+	}
+	return false
+}
+
+// BuildCanaryProbePod generalizes the original plaintext-GET canary pod to
+// the full set of CanaryProbe options: scheme, method, mTLS client cert, and
+// timeout.
+func BuildCanaryProbePod(name, namespace, image, host string, probe operatorv1.CanaryProbe) *corev1.Pod {
+	scheme := "http"
+	switch probe.Scheme {
+	case operatorv1.CanaryProbeSchemeHTTPS:
+		scheme = "https"
+	case operatorv1.CanaryProbeSchemeHTTP2:
+		scheme = "https"
+	}
+
+	method := probe.Method
+	if method == "" {
+		method = "GET"
+	}
+
+	timeout := probe.Timeout.Duration
+	if timeout <= 0 {
+		timeout = 2 * time.Second
+	}
+
+	curlArgs := []string{
+		"-s", "-v", "-X", method,
+		"--max-time", fmt.Sprintf("%.0f", timeout.Seconds()),
+	}
+	if probe.Scheme == operatorv1.CanaryProbeSchemeHTTP2 {
+		curlArgs = append(curlArgs, "--http2")
+	}
+	if probe.Scheme == operatorv1.CanaryProbeSchemeHTTPS || probe.Scheme == operatorv1.CanaryProbeSchemeHTTP2 {
+		curlArgs = append(curlArgs, "-k")
+	}
+	if probe.ClientCertificateSecret != "" {
+		curlArgs = append(curlArgs,
+			"--cert", "/etc/canary-tls/tls.crt",
+			"--key", "/etc/canary-tls/tls.key")
+	}
+	curlArgs = append(curlArgs, scheme+"://"+host)
+
+	pod := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: namespace,
+		},
+		Spec: corev1.PodSpec{
+			Containers: []corev1.Container{
+				{
+					Name:    "curl",
+					Image:   image,
+					Command: []string{"/bin/curl"},
+					Args:    curlArgs,
+				},
+			},
+			RestartPolicy: corev1.RestartPolicyNever,
+		},
+	}
+
+	if probe.ClientCertificateSecret != "" {
+		pod.Spec.Volumes = append(pod.Spec.Volumes, corev1.Volume{
+			Name: "canary-tls",
+			VolumeSource: corev1.VolumeSource{
+				Secret: &corev1.SecretVolumeSource{SecretName: probe.ClientCertificateSecret},
+			},
+		})
+		pod.Spec.Containers[0].VolumeMounts = append(pod.Spec.Containers[0].VolumeMounts, corev1.VolumeMount{
+			Name:      "canary-tls",
+			MountPath: "/etc/canary-tls",
+			ReadOnly:  true,
+		})
+	}
+
+	return pod
+}
+
+// pollLogsUntilComplete waits for the probe pod to terminate and then
+// invokes onLine for each line of its logs.
+func pollLogsUntilComplete(ctx context.Context, kubeClient kubernetes.Interface, namespace, name string, timeout time.Duration, onLine func(string) bool) error {
+	if timeout <= 0 {
+		timeout = 30 * time.Second
+	}
+
+	var logs string
+	err := wait.PollImmediate(1*time.Second, timeout+30*time.Second, func() (bool, error) {
+		pod, err := kubeClient.CoreV1().Pods(namespace).Get(ctx, name, metav1.GetOptions{})
+		if err != nil {
+			return false, nil
+		}
+		if pod.Status.Phase != corev1.PodSucceeded && pod.Status.Phase != corev1.PodFailed {
+			return false, nil
+		}
+
+		readCloser, err := kubeClient.CoreV1().Pods(namespace).GetLogs(name, &corev1.PodLogOptions{Container: "curl"}).Stream(ctx)
+		if err != nil {
+			return false, nil
+		}
+		defer readCloser.Close()
+
+		var b strings.Builder
+		scanner := bufio.NewScanner(readCloser)
+		for scanner.Scan() {
+			b.WriteString(scanner.Text())
+			b.WriteString("\n")
+		}
+		logs = b.String()
+		return true, nil
+	})
+	if err != nil {
+		return fmt.Errorf("timed out waiting for probe pod %s/%s to complete: %w", namespace, name, err)
+	}
+
+	scanner := bufio.NewScanner(strings.NewReader(logs))
+	for scanner.Scan() {
+		if onLine(scanner.Text()) {
+			break
+		}
+	}
+	return nil
+}
@@ -0,0 +1,82 @@
+package canary
+
+import (
+	"testing"
+
+	operatorv1 "github.com/openshift/api/operator/v1"
+)
+
+func TestProbeAttemptPodNameIsUniquePerAttempt(t *testing.T) {
+	seen := map[string]bool{}
+	for attempt := int32(0); attempt < 5; attempt++ {
+		name := probeAttemptPodName("canary-probe-0", attempt)
+		if seen[name] {
+			t.Fatalf("attempt %d produced a pod name already used by an earlier attempt: %q", attempt, name)
+		}
+		seen[name] = true
+	}
+}
+
+func TestAssertProbeOutput(t *testing.T) {
+	testCases := []struct {
+		name   string
+		output string
+		probe  operatorv1.CanaryProbe
+		expect bool
+	}{
+		{
+			name:   "matching status code",
+			output: "< HTTP/1.1 200 OK\n",
+			probe:  operatorv1.CanaryProbe{ExpectedStatusCodes: []int32{200}},
+			expect: true,
+		},
+		{
+			name:   "non-matching status code",
+			output: "< HTTP/1.1 503 Service Unavailable\n",
+			probe:  operatorv1.CanaryProbe{ExpectedStatusCodes: []int32{200}},
+			expect: false,
+		},
+		{
+			name:   "matching header",
+			output: "< HTTP/1.1 200 OK\n< X-Request-Port: 8080\n",
+			probe: operatorv1.CanaryProbe{
+				ExpectedStatusCodes: []int32{200},
+				ExpectedHeaders:      []operatorv1.CanaryProbeHeaderAssertion{{Name: "X-Request-Port", ValueRegex: "[0-9]+"}},
+			},
+			expect: true,
+		},
+		{
+			name:   "missing header",
+			output: "< HTTP/1.1 200 OK\n",
+			probe: operatorv1.CanaryProbe{
+				ExpectedStatusCodes: []int32{200},
+				ExpectedHeaders:      []operatorv1.CanaryProbeHeaderAssertion{{Name: "X-Request-Port", ValueRegex: "[0-9]+"}},
+			},
+			expect: false,
+		},
+		{
+			name:   "matching body regex",
+			output: "Hello OpenShift!\n",
+			probe:  operatorv1.CanaryProbe{BodyRegex: "Hello OpenShift!"},
+			expect: true,
+		},
+		{
+			name:   "non-matching body regex",
+			output: "goodbye\n",
+			probe:  operatorv1.CanaryProbe{BodyRegex: "Hello OpenShift!"},
+			expect: false,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			ok, err := AssertProbeOutput(tc.output, tc.probe)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if ok != tc.expect {
+				t.Errorf("expected %v, got %v", tc.expect, ok)
+			}
+		})
+	}
+}
@@ -0,0 +1,41 @@
+package canary
+
+import (
+	"context"
+	"time"
+
+	model "github.com/prometheus/common/model"
+
+	operatorv1 "github.com/openshift/api/operator/v1"
+	routev1 "github.com/openshift/api/route/v1"
+
+	"github.com/openshift/cluster-ingress-operator/pkg/operator/controller"
+
+	"sigs.k8s.io/controller-runtime/pkg/client"
+)
+
+// timeNow exists so the Prometheus query instant can be stubbed out in
+// tests; outside of tests it is always the wall clock.
+var timeNow = time.Now
+
+// metricWithinThreshold reports whether result satisfies the bound
+// configured for m. Only instant vector results with a single sample are
+// supported, which matches the aggregate queries (e.g. success-rate, p99
+// latency) the analysis loop is expected to be configured with.
+func metricWithinThreshold(result model.Value, m operatorv1.CanaryMetric) bool {
+	vector, ok := result.(model.Vector)
+	if !ok || len(vector) == 0 {
+		return false
+	}
+	value := float64(vector[0].Value)
+	return value >= m.ThresholdMin && value <= m.ThresholdMax
+}
+
+func canaryRoute(ctx context.Context, cl client.Client) (*routev1.Route, error) {
+	route := &routev1.Route{}
+	name := controller.CanaryRouteName()
+	if err := cl.Get(ctx, name, route); err != nil {
+		return nil, err
+	}
+	return route, nil
+}
@@ -5,6 +5,7 @@ package e2e
 import (
 	"bufio"
 	"context"
+	"fmt"
 	"strings"
 	"testing"
 	"time"
@@ -14,8 +15,10 @@ import (
 
 	operatorclient "github.com/openshift/cluster-ingress-operator/pkg/operator/client"
 	"github.com/openshift/cluster-ingress-operator/pkg/operator/controller"
+	"github.com/openshift/cluster-ingress-operator/pkg/operator/controller/canary"
 	ingresscontroller "github.com/openshift/cluster-ingress-operator/pkg/operator/controller/ingress"
 
+	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/client/config"
 
 	appsv1 "k8s.io/api/apps/v1"
@@ -25,9 +28,10 @@ import (
 	"k8s.io/client-go/kubernetes"
 )
 
-// TestCanaryRoute tests the ingress canary route
-// and checks that the hello-openshift echo server
-// works as expected.
+// TestCanaryRoute tests the ingress canary route and checks that every
+// probe configured on the default ingress controller's Spec.CanaryProbes
+// (or canary.DefaultProbes, if none are configured) passes against the
+// hello-openshift echo server.
 func TestCanaryRoute(t *testing.T) {
 	kubeConfig, err := config.GetConfig()
 	if err != nil {
@@ -75,10 +79,26 @@ func TestCanaryRoute(t *testing.T) {
 		t.Fatalf("failed to observe canary route: %v", err)
 	}
 
+	probes := def.Spec.CanaryProbes
+	if len(probes) == 0 {
+		probes = canary.DefaultProbes
+	}
+
 	image := deployment.Spec.Template.Spec.Containers[0].Image
-	clientPod := buildCanaryCurlPod("canary-route-check", canaryRoute.Namespace, image, canaryRoute.Spec.Host)
+	for i, probe := range probes {
+		if err := runCanaryProbe(t, kubeClient, client, image, canaryRoute.Namespace, canaryRoute.Spec.Host, i, probe); err != nil {
+			t.Fatalf("canary probe %d failed: %v", i, err)
+		}
+	}
+}
+
+// runCanaryProbe runs a single configured canary probe against host and
+// asserts that its configured status code, header, and body expectations
+// are met within 5 minutes.
+func runCanaryProbe(t *testing.T, kubeClient client.Client, kubeClientset kubernetes.Interface, image, namespace, host string, index int, probe operatorv1.CanaryProbe) error {
+	clientPod := canary.BuildCanaryProbePod(fmt.Sprintf("canary-route-check-%d", index), namespace, image, host, probe)
 	if err := kubeClient.Create(context.TODO(), clientPod); err != nil {
-		t.Fatalf("failed to create pod %s/%s: %v", clientPod.Namespace, clientPod.Name, err)
+		return fmt.Errorf("failed to create pod %s/%s: %w", clientPod.Namespace, clientPod.Name, err)
 	}
 	defer func() {
 		if err := kubeClient.Delete(context.TODO(), clientPod); err != nil {
@@ -86,40 +106,33 @@ func TestCanaryRoute(t *testing.T) {
 		}
 	}()
 
-	// Test canary route and verify that the hello-openshift echo pod is running properly.
-	err = wait.PollImmediate(1*time.Second, 5*time.Minute, func() (bool, error) {
-		readCloser, err := client.CoreV1().Pods(clientPod.Namespace).GetLogs(clientPod.Name, &corev1.PodLogOptions{
+	return wait.PollImmediate(1*time.Second, 5*time.Minute, func() (bool, error) {
+		readCloser, err := kubeClientset.CoreV1().Pods(clientPod.Namespace).GetLogs(clientPod.Name, &corev1.PodLogOptions{
 			Container: "curl",
 			Follow:    false,
 		}).Stream(context.TODO())
 		if err != nil {
 			return false, nil
 		}
-		scanner := bufio.NewScanner(readCloser)
 		defer func() {
 			if err := readCloser.Close(); err != nil {
 				t.Errorf("failed to close reader for pod %s: %v", clientPod.Name, err)
 			}
 		}()
-		foundBody := false
-		foundRequestPortHeader := false
+
+		var output strings.Builder
+		scanner := bufio.NewScanner(readCloser)
 		for scanner.Scan() {
-			line := scanner.Text()
-			if strings.Contains(line, "Hello OpenShift!") {
-				foundBody = true
-			}
-			if strings.Contains(strings.ToLower(line), "x-request-port:") {
-				foundRequestPortHeader = true
-			}
-			if foundBody && foundRequestPortHeader {
-				return true, nil
-			}
+			output.WriteString(scanner.Text())
+			output.WriteString("\n")
 		}
-		return false, nil
+
+		ok, err := canary.AssertProbeOutput(output.String(), probe)
+		if err != nil {
+			return false, err
+		}
+		return ok, nil
 	})
-	if err != nil {
-		t.Fatalf("failed to observe the expected canary response body: %v", err)
-	}
 }
 
 // TestCanaryStatusCondition ensures that the default
@@ -147,31 +160,93 @@ func TestCanaryStatusCondition(t *testing.T) {
 	if err := waitForIngressControllerCondition(t, kubeClient, 5*time.Minute, defaultName, conditions...); err != nil {
 		t.Fatalf("failed to observe expected canary conditions: %v", err)
 	}
+
+	// Per-endpoint canary reporting should also have published at least
+	// one healthy entry for the default ingress controller's router pods,
+	// and CanaryEndpointDegraded should be false since the default
+	// deployment isn't failing.
+	def := &operatorv1.IngressController{}
+	if err := kubeClient.Get(context.TODO(), defaultName, def); err != nil {
+		t.Fatalf("failed to get default ingresscontroller: %v", err)
+	}
+
+	if len(def.Status.CanaryEndpoints) == 0 {
+		t.Fatalf("expected at least one canary endpoint status to be reported")
+	}
+	for _, endpoint := range def.Status.CanaryEndpoints {
+		if !endpoint.OK {
+			t.Errorf("expected router pod %s canary endpoint to be healthy, got message %q", endpoint.RouterPod, endpoint.Message)
+		}
+	}
+
+	degraded := []operatorv1.OperatorCondition{
+		{Type: canary.CanaryEndpointDegradedConditionType, Status: operatorv1.ConditionFalse},
+	}
+	if err := waitForIngressControllerCondition(t, kubeClient, 5*time.Minute, defaultName, degraded...); err != nil {
+		t.Fatalf("failed to observe expected canary endpoint degraded condition: %v", err)
+	}
 }
 
-// buildCanaryCurlPod returns a pod definition for a pod with the given name and image
-// and in the given namespace that curls the specified route via the route's hostname.
-func buildCanaryCurlPod(name, namespace, image, host string) *corev1.Pod {
-	curlArgs := []string{
-		"-s", "-v",
-		"--retry", "300", "--retry-delay", "1", "--max-time", "2",
-	}
-	curlArgs = append(curlArgs, "http://"+host)
-	return &corev1.Pod{
-		ObjectMeta: metav1.ObjectMeta{
-			Name:      name,
-			Namespace: namespace,
-		},
-		Spec: corev1.PodSpec{
-			Containers: []corev1.Container{
-				{
-					Name:    "curl",
-					Image:   image,
-					Command: []string{"/bin/curl"},
-					Args:    curlArgs,
-				},
-			},
-			RestartPolicy: corev1.RestartPolicyNever,
+// TestCanaryAnalysisHaltsOnBadRollout configures a progressive canary
+// analysis on the default ingress controller, forces a rollout to a
+// deliberately broken router image, and asserts that the analysis halts and
+// rolls back instead of letting the bad image take over all router traffic.
+func TestCanaryAnalysisHaltsOnBadRollout(t *testing.T) {
+	kubeConfig, err := config.GetConfig()
+	if err != nil {
+		t.Fatalf("failed to get kube config: %v", err)
+	}
+	kubeClient, err := operatorclient.NewClient(kubeConfig)
+	if err != nil {
+		t.Fatalf("failed to create kube client: %s\n", err)
+	}
+
+	if err := waitForIngressControllerCondition(t, kubeClient, 5*time.Minute, defaultName, defaultAvailableConditions...); err != nil {
+		t.Fatalf("failed to observe expected conditions: %v", err)
+	}
+
+	ic := &operatorv1.IngressController{}
+	if err := kubeClient.Get(context.TODO(), defaultName, ic); err != nil {
+		t.Fatalf("failed to get default ingresscontroller: %v", err)
+	}
+
+	updated := ic.DeepCopy()
+	updated.Spec.CanaryAnalysis = &operatorv1.CanaryAnalysis{
+		StepWeight: 10,
+		MaxWeight:  50,
+		Interval:   metav1.Duration{Duration: 5 * time.Second},
+		Threshold:  2,
+		Metrics: []operatorv1.CanaryMetric{
+			{Name: "request-success-rate", ThresholdMin: 99, ThresholdMax: 100},
 		},
 	}
+	if err := kubeClient.Update(context.TODO(), updated); err != nil {
+		t.Fatalf("failed to configure canary analysis on ingresscontroller: %v", err)
+	}
+
+	deployment := &appsv1.Deployment{}
+	if err := kubeClient.Get(context.TODO(), controller.RouterDeploymentName(ic), deployment); err != nil {
+		t.Fatalf("failed to get ingresscontroller deployment: %v", err)
+	}
+	deployment.Spec.Template.Spec.Containers[0].Image = "image-registry.openshift-image-registry.svc:5000/openshift-ingress/router:does-not-exist"
+	if err := kubeClient.Update(context.TODO(), deployment); err != nil {
+		t.Fatalf("failed to roll out broken router image: %v", err)
+	}
+
+	conditions := []operatorv1.OperatorCondition{
+		{Type: canary.CanaryAnalysisHaltedConditionType, Status: operatorv1.ConditionTrue},
+	}
+	if err := waitForIngressControllerCondition(t, kubeClient, 5*time.Minute, defaultName, conditions...); err != nil {
+		t.Fatalf("failed to observe halted canary analysis after bad rollout: %v", err)
+	}
+
+	if err := wait.PollImmediate(5*time.Second, 5*time.Minute, func() (bool, error) {
+		current := &operatorv1.IngressController{}
+		if err := kubeClient.Get(context.TODO(), defaultName, current); err != nil {
+			return false, nil
+		}
+		return current.Status.CanaryWeight == 0, nil
+	}); err != nil {
+		t.Fatalf("failed to observe canary weight rolled back to 0: %v", err)
+	}
 }